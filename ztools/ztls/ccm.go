@@ -0,0 +1,196 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ztls
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// This file implements AES-CCM (RFC 3610, as profiled for TLS by RFC 6655
+// and RFC 7251) since neither crypto/cipher nor x/crypto vendors one. It is
+// only ever constructed with a 12-byte nonce and a 16-byte block cipher
+// (AES), which is all the CCM and CCM_8 TLS cipher suites need.
+
+const (
+	ccmBlockSize = 16
+	ccmNonceSize = 12
+)
+
+type ccm struct {
+	block   cipher.Block
+	tagSize int
+}
+
+// newCCM wraps block (which must have a 16-byte block size, i.e. be AES) in
+// CCM mode with the given authentication tag size: 16 for the *_CCM suites,
+// 8 for the *_CCM_8 ones.
+func newCCM(block cipher.Block, tagSize int) (cipher.AEAD, error) {
+	if block.BlockSize() != ccmBlockSize {
+		return nil, errors.New("ztls: CCM requires a 128-bit block cipher")
+	}
+	if tagSize != 8 && tagSize != 16 {
+		return nil, errors.New("ztls: unsupported CCM tag size")
+	}
+	return &ccm{block: block, tagSize: tagSize}, nil
+}
+
+func (c *ccm) NonceSize() int { return ccmNonceSize }
+func (c *ccm) Overhead() int  { return c.tagSize }
+
+// flags0 builds the flags byte of B0 (counterBlock sets the counter blocks'
+// own flags byte); q is always 3 since the nonce is fixed at 12 bytes (L=3).
+func (c *ccm) flags0(hasAdata bool) byte {
+	var flags byte
+	if hasAdata {
+		flags |= 0x40
+	}
+	flags |= byte((c.tagSize-2)/2) << 3
+	flags |= 2 // L - 1, with L == 3
+	return flags
+}
+
+func (c *ccm) counterBlock(nonce []byte, counter uint32) [ccmBlockSize]byte {
+	var block [ccmBlockSize]byte
+	block[0] = 2 // L - 1
+	copy(block[1:1+ccmNonceSize], nonce)
+	putUint24(block[1+ccmNonceSize:], counter)
+	return block
+}
+
+// cbcMAC computes the CBC-MAC (RFC 3610 section 2.2) over B0 followed by
+// the encoded additionalData and plaintext, returning the full-size (16
+// byte) MAC; the caller truncates it to the negotiated tag size.
+func (c *ccm) cbcMAC(nonce, additionalData, plaintext []byte) [ccmBlockSize]byte {
+	var b0 [ccmBlockSize]byte
+	b0[0] = c.flags0(len(additionalData) > 0)
+	copy(b0[1:1+ccmNonceSize], nonce)
+	putUint24(b0[1+ccmNonceSize:], uint32(len(plaintext)))
+
+	var y [ccmBlockSize]byte
+	c.block.Encrypt(y[:], b0[:])
+
+	xorBlockInto := func(data []byte) {
+		for len(data) > 0 {
+			n := ccmBlockSize
+			if len(data) < n {
+				n = len(data)
+			}
+			for i := 0; i < n; i++ {
+				y[i] ^= data[i]
+			}
+			c.block.Encrypt(y[:], y[:])
+			data = data[n:]
+		}
+	}
+
+	if len(additionalData) > 0 {
+		var lenBuf [2]byte
+		binary.BigEndian.PutUint16(lenBuf[:], uint16(len(additionalData)))
+		// The length prefix and the start of additionalData share the
+		// first CCM block after B0; the last partial block is zero-padded.
+		first := make([]byte, 0, ccmBlockSize)
+		first = append(first, lenBuf[:]...)
+		first = append(first, additionalData...)
+		xorBlockInto(first)
+	}
+	xorBlockInto(plaintext)
+
+	return y
+}
+
+func (c *ccm) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != ccmNonceSize {
+		panic("ztls: incorrect nonce length given to CCM")
+	}
+
+	mac := c.cbcMAC(nonce, additionalData, plaintext)
+	s0 := c.counterBlock(nonce, 0)
+	var encryptedS0 [ccmBlockSize]byte
+	c.block.Encrypt(encryptedS0[:], s0[:])
+
+	ret, out := sliceForAppend(dst, len(plaintext)+c.tagSize)
+	c.ctr(out[:len(plaintext)], nonce, plaintext)
+	for i := 0; i < c.tagSize; i++ {
+		out[len(plaintext)+i] = mac[i] ^ encryptedS0[i]
+	}
+	return ret
+}
+
+func (c *ccm) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != ccmNonceSize {
+		panic("ztls: incorrect nonce length given to CCM")
+	}
+	if len(ciphertext) < c.tagSize {
+		return nil, errors.New("ztls: CCM ciphertext too short")
+	}
+
+	tag := ciphertext[len(ciphertext)-c.tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-c.tagSize]
+
+	plaintext := make([]byte, len(ciphertext))
+	c.ctr(plaintext, nonce, ciphertext)
+
+	mac := c.cbcMAC(nonce, additionalData, plaintext)
+	s0 := c.counterBlock(nonce, 0)
+	var encryptedS0 [ccmBlockSize]byte
+	c.block.Encrypt(encryptedS0[:], s0[:])
+
+	expectedTag := make([]byte, c.tagSize)
+	for i := 0; i < c.tagSize; i++ {
+		expectedTag[i] = mac[i] ^ encryptedS0[i]
+	}
+	if subtle.ConstantTimeCompare(tag, expectedTag) != 1 {
+		return nil, errors.New("ztls: CCM authentication failed")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext))
+	copy(out, plaintext)
+	return ret, nil
+}
+
+// ctr encrypts/decrypts in counter mode, starting at counter block 1 (block
+// 0 is reserved for masking the tag).
+func (c *ccm) ctr(dst []byte, nonce, src []byte) {
+	counter := uint32(1)
+	for len(src) > 0 {
+		block := c.counterBlock(nonce, counter)
+		var keystream [ccmBlockSize]byte
+		c.block.Encrypt(keystream[:], block[:])
+
+		n := ccmBlockSize
+		if len(src) < n {
+			n = len(src)
+		}
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ keystream[i]
+		}
+		dst = dst[n:]
+		src = src[n:]
+		counter++
+	}
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
+
+// sliceForAppend is lifted from crypto/cipher's GCM implementation: it
+// extends dst (if it has the capacity) or allocates a new slice, and
+// returns both the full result and the appended portion.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
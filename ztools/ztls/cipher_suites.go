@@ -9,10 +9,14 @@ import (
 	"crypto/cipher"
 	"crypto/des"
 	"crypto/hmac"
+	"crypto/md5"
 	"crypto/rc4"
 	"crypto/sha1"
+	"fmt"
 	"hash"
 
+	"golang.org/x/crypto/chacha20poly1305"
+
 	"github.com/zmap/zgrab/ztools/x509"
 )
 
@@ -49,12 +53,28 @@ const (
 	// suiteTLS12 indicates that the cipher suite should only be advertised
 	// and accepted when using TLS 1.2.
 	suiteTLS12
+	// suitePSK indicates that the cipher suite authenticates the
+	// connection with a pre-shared key rather than a certificate (RFC
+	// 4279, RFC 5489).
+	suitePSK
 )
 
 // A cipherSuite is a specific combination of key agreement, cipher and MAC
-// function. All cipher suites currently assume RSA key agreement.
+// function. The name/keyExchange/cipherName/macName/insecure fields are
+// descriptive metadata, not used by the handshake itself; they back the
+// public CipherSuites/InsecureCipherSuites API below, so that this table
+// is the single source of truth for the suites this package can actually
+// negotiate. (CipherSuiteName consults cipherSuiteNames, below, instead
+// of this table, so it can name suites outside this table too.)
 type cipherSuite struct {
 	id uint16
+
+	name        string
+	keyExchange string
+	cipherName  string
+	macName     string
+	insecure    bool
+
 	// the lengths, in bytes, of the key material needed for each component.
 	keyLen int
 	macLen int
@@ -70,20 +90,67 @@ type cipherSuite struct {
 var cipherSuites = []*cipherSuite{
 	// Ciphersuite order is chosen so that ECDHE comes before plain RSA
 	// and RC4 comes before AES (because of the Lucky13 attack).
-	{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, 16, 0, 4, ecdheRSAKA, suiteECDHE | suiteTLS12, nil, nil, aeadAESGCM},
-	{TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, 16, 0, 4, ecdheECDSAKA, suiteECDHE | suiteECDSA | suiteTLS12, nil, nil, aeadAESGCM},
-	{TLS_ECDHE_RSA_WITH_RC4_128_SHA, 16, 20, 0, ecdheRSAKA, suiteECDHE, cipherRC4, macSHA1, nil},
-	{TLS_ECDHE_ECDSA_WITH_RC4_128_SHA, 16, 20, 0, ecdheECDSAKA, suiteECDHE | suiteECDSA, cipherRC4, macSHA1, nil},
-	{TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, 16, 20, 16, ecdheRSAKA, suiteECDHE, cipherAES, macSHA1, nil},
-	{TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, 16, 20, 16, ecdheECDSAKA, suiteECDHE | suiteECDSA, cipherAES, macSHA1, nil},
-	{TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, 32, 20, 16, ecdheRSAKA, suiteECDHE, cipherAES, macSHA1, nil},
-	{TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, 32, 20, 16, ecdheECDSAKA, suiteECDHE | suiteECDSA, cipherAES, macSHA1, nil},
-	{TLS_RSA_WITH_RC4_128_SHA, 16, 20, 0, rsaKA, 0, cipherRC4, macSHA1, nil},
-	{TLS_RSA_WITH_AES_128_GCM_SHA256, 16, 0, 4, rsaKA, 0, nil, nil, aeadAESGCM},
-	{TLS_RSA_WITH_AES_128_CBC_SHA, 16, 20, 16, rsaKA, 0, cipherAES, macSHA1, nil},
-	{TLS_RSA_WITH_AES_256_CBC_SHA, 32, 20, 16, rsaKA, 0, cipherAES, macSHA1, nil},
-	{TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, 24, 20, 8, ecdheRSAKA, suiteECDHE, cipher3DES, macSHA1, nil},
-	{TLS_RSA_WITH_3DES_EDE_CBC_SHA, 24, 20, 8, rsaKA, 0, cipher3DES, macSHA1, nil},
+	{id: TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, name: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", keyExchange: "ECDHE", cipherName: "AES128GCM", keyLen: 16, ivLen: 4, ka: ecdheRSAKA, flags: suiteECDHE | suiteTLS12, aead: aeadAESGCM},
+	{id: TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, name: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", keyExchange: "ECDHE", cipherName: "AES128GCM", keyLen: 16, ivLen: 4, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA | suiteTLS12, aead: aeadAESGCM},
+	{id: TLS_ECDHE_RSA_WITH_RC4_128_SHA, name: "TLS_ECDHE_RSA_WITH_RC4_128_SHA", keyExchange: "ECDHE", cipherName: "RC4", macName: "SHA1", insecure: true, keyLen: 16, macLen: 20, ka: ecdheRSAKA, flags: suiteECDHE, cipher: cipherRC4, mac: macSHA1},
+	{id: TLS_ECDHE_ECDSA_WITH_RC4_128_SHA, name: "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA", keyExchange: "ECDHE", cipherName: "RC4", macName: "SHA1", insecure: true, keyLen: 16, macLen: 20, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA, cipher: cipherRC4, mac: macSHA1},
+	{id: TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, name: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA", keyExchange: "ECDHE", cipherName: "AES128", macName: "SHA1", keyLen: 16, macLen: 20, ivLen: 16, ka: ecdheRSAKA, flags: suiteECDHE, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, name: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA", keyExchange: "ECDHE", cipherName: "AES128", macName: "SHA1", keyLen: 16, macLen: 20, ivLen: 16, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, name: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA", keyExchange: "ECDHE", cipherName: "AES256", macName: "SHA1", keyLen: 32, macLen: 20, ivLen: 16, ka: ecdheRSAKA, flags: suiteECDHE, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, name: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA", keyExchange: "ECDHE", cipherName: "AES256", macName: "SHA1", keyLen: 32, macLen: 20, ivLen: 16, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_RSA_WITH_RC4_128_SHA, name: "TLS_RSA_WITH_RC4_128_SHA", keyExchange: "RSA", cipherName: "RC4", macName: "SHA1", insecure: true, keyLen: 16, macLen: 20, ka: rsaKA, cipher: cipherRC4, mac: macSHA1},
+	{id: TLS_RSA_WITH_AES_128_GCM_SHA256, name: "TLS_RSA_WITH_AES_128_GCM_SHA256", keyExchange: "RSA", cipherName: "AES128GCM", keyLen: 16, ivLen: 4, ka: rsaKA, aead: aeadAESGCM},
+	{id: TLS_RSA_WITH_AES_128_CBC_SHA, name: "TLS_RSA_WITH_AES_128_CBC_SHA", keyExchange: "RSA", cipherName: "AES128", macName: "SHA1", keyLen: 16, macLen: 20, ivLen: 16, ka: rsaKA, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_RSA_WITH_AES_256_CBC_SHA, name: "TLS_RSA_WITH_AES_256_CBC_SHA", keyExchange: "RSA", cipherName: "AES256", macName: "SHA1", keyLen: 32, macLen: 20, ivLen: 16, ka: rsaKA, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, name: "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA", keyExchange: "ECDHE", cipherName: "3DES", macName: "SHA1", insecure: true, keyLen: 24, macLen: 20, ivLen: 8, ka: ecdheRSAKA, flags: suiteECDHE, cipher: cipher3DES, mac: macSHA1},
+	{id: TLS_RSA_WITH_3DES_EDE_CBC_SHA, name: "TLS_RSA_WITH_3DES_EDE_CBC_SHA", keyExchange: "RSA", cipherName: "3DES", macName: "SHA1", insecure: true, keyLen: 24, macLen: 20, ivLen: 8, ka: rsaKA, cipher: cipher3DES, mac: macSHA1},
+	{id: TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, name: "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256", keyExchange: "ECDHE", cipherName: "CHACHA20-POLY1305", keyLen: 32, ivLen: 12, ka: ecdheRSAKA, flags: suiteECDHE | suiteTLS12, aead: aeadChaCha20Poly1305},
+	{id: TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, name: "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256", keyExchange: "ECDHE", cipherName: "CHACHA20-POLY1305", keyLen: 32, ivLen: 12, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA | suiteTLS12, aead: aeadChaCha20Poly1305},
+	{id: TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256, name: "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256", keyExchange: "DHE", cipherName: "CHACHA20-POLY1305", keyLen: 32, ivLen: 12, ka: dheRSAKA, flags: suiteTLS12, aead: aeadChaCha20Poly1305},
+
+	// DHE suites. Registering these lets a scan that advertises DHECiphers
+	// or DHEExportCiphers actually complete the handshake and observe the
+	// server's chosen group, which is the whole point of FREAK/Logjam-style
+	// measurement.
+	{id: TLS_DHE_RSA_WITH_AES_128_CBC_SHA, name: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA", keyExchange: "DHE", cipherName: "AES128", macName: "SHA1", keyLen: 16, macLen: 20, ivLen: 16, ka: dheRSAKA, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_DHE_RSA_WITH_AES_256_CBC_SHA, name: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA", keyExchange: "DHE", cipherName: "AES256", macName: "SHA1", keyLen: 32, macLen: 20, ivLen: 16, ka: dheRSAKA, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_DHE_RSA_WITH_3DES_EDE_CBC_SHA, name: "TLS_DHE_RSA_WITH_3DES_EDE_CBC_SHA", keyExchange: "DHE", cipherName: "3DES", macName: "SHA1", insecure: true, keyLen: 24, macLen: 20, ivLen: 8, ka: dheRSAKA, cipher: cipher3DES, mac: macSHA1},
+
+	// TLS_DHE_DSS_* suites are deliberately not registered here: this
+	// package doesn't implement DSA ServerKeyExchange signature
+	// verification, so they could never complete a handshake.
+
+	// Export-grade suites. The 40-bit keys are weak by design; the goal of
+	// registering them is to complete the handshake and record the
+	// ephemeral key parameters the server offered (FREAK for the RSA
+	// suites, Logjam for the DHE ones), not to use them securely.
+	{id: TLS_RSA_EXPORT_WITH_RC4_40_MD5, name: "TLS_RSA_EXPORT_WITH_RC4_40_MD5", keyExchange: "RSA", cipherName: "RC4_40", macName: "MD5", insecure: true, keyLen: 5, macLen: 16, ka: rsaExportKA, cipher: cipherRC4, mac: macMD5},
+	{id: TLS_RSA_EXPORT_WITH_DES40_CBC_SHA, name: "TLS_RSA_EXPORT_WITH_DES40_CBC_SHA", keyExchange: "RSA", cipherName: "DES40", macName: "SHA1", insecure: true, keyLen: 5, macLen: 20, ivLen: 8, ka: rsaExportKA, cipher: cipherDES, mac: macSHA1},
+	{id: TLS_DHE_RSA_EXPORT_WITH_DES40_CBC_SHA, name: "TLS_DHE_RSA_EXPORT_WITH_DES40_CBC_SHA", keyExchange: "DHE", cipherName: "DES40", macName: "SHA1", insecure: true, keyLen: 5, macLen: 20, ivLen: 8, ka: dheRSAKA, cipher: cipherDES, mac: macSHA1},
+
+	// AES-CCM suites (RFC 6655, RFC 7251), increasingly the standard AEAD
+	// for constrained IoT/DTLS deployments. ivLen is 4: the fixed part of
+	// the 12-byte CCM nonce, with the remaining 8 bytes carried as the
+	// record's explicit nonce, same as the GCM suites above.
+	{id: TLS_RSA_WITH_AES_128_CCM, name: "TLS_RSA_WITH_AES_128_CCM", keyExchange: "RSA", cipherName: "AES128-CCM", keyLen: 16, ivLen: 4, ka: rsaKA, flags: suiteTLS12, aead: aeadAESCCM},
+	{id: TLS_RSA_WITH_AES_256_CCM, name: "TLS_RSA_WITH_AES_256_CCM", keyExchange: "RSA", cipherName: "AES256-CCM", keyLen: 32, ivLen: 4, ka: rsaKA, flags: suiteTLS12, aead: aeadAESCCM},
+	{id: TLS_RSA_WITH_AES_128_CCM_8, name: "TLS_RSA_WITH_AES_128_CCM_8", keyExchange: "RSA", cipherName: "AES128-CCM8", keyLen: 16, ivLen: 4, ka: rsaKA, flags: suiteTLS12, aead: aeadAESCCM8},
+	{id: TLS_RSA_WITH_AES_256_CCM_8, name: "TLS_RSA_WITH_AES_256_CCM_8", keyExchange: "RSA", cipherName: "AES256-CCM8", keyLen: 32, ivLen: 4, ka: rsaKA, flags: suiteTLS12, aead: aeadAESCCM8},
+	{id: TLS_DHE_RSA_WITH_AES_128_CCM, name: "TLS_DHE_RSA_WITH_AES_128_CCM", keyExchange: "DHE", cipherName: "AES128-CCM", keyLen: 16, ivLen: 4, ka: dheRSAKA, flags: suiteTLS12, aead: aeadAESCCM},
+	{id: TLS_DHE_RSA_WITH_AES_256_CCM, name: "TLS_DHE_RSA_WITH_AES_256_CCM", keyExchange: "DHE", cipherName: "AES256-CCM", keyLen: 32, ivLen: 4, ka: dheRSAKA, flags: suiteTLS12, aead: aeadAESCCM},
+	{id: TLS_DHE_RSA_WITH_AES_128_CCM_8, name: "TLS_DHE_RSA_WITH_AES_128_CCM_8", keyExchange: "DHE", cipherName: "AES128-CCM8", keyLen: 16, ivLen: 4, ka: dheRSAKA, flags: suiteTLS12, aead: aeadAESCCM8},
+	{id: TLS_DHE_RSA_WITH_AES_256_CCM_8, name: "TLS_DHE_RSA_WITH_AES_256_CCM_8", keyExchange: "DHE", cipherName: "AES256-CCM8", keyLen: 32, ivLen: 4, ka: dheRSAKA, flags: suiteTLS12, aead: aeadAESCCM8},
+	{id: TLS_ECDHE_ECDSA_WITH_AES_128_CCM, name: "TLS_ECDHE_ECDSA_WITH_AES_128_CCM", keyExchange: "ECDHE", cipherName: "AES128-CCM", keyLen: 16, ivLen: 4, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA | suiteTLS12, aead: aeadAESCCM},
+	{id: TLS_ECDHE_ECDSA_WITH_AES_256_CCM, name: "TLS_ECDHE_ECDSA_WITH_AES_256_CCM", keyExchange: "ECDHE", cipherName: "AES256-CCM", keyLen: 32, ivLen: 4, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA | suiteTLS12, aead: aeadAESCCM},
+	{id: TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8, name: "TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8", keyExchange: "ECDHE", cipherName: "AES128-CCM8", keyLen: 16, ivLen: 4, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA | suiteTLS12, aead: aeadAESCCM8},
+	{id: TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8, name: "TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8", keyExchange: "ECDHE", cipherName: "AES256-CCM8", keyLen: 32, ivLen: 4, ka: ecdheECDSAKA, flags: suiteECDHE | suiteECDSA | suiteTLS12, aead: aeadAESCCM8},
+
+	// PSK and ECDHE-PSK suites (RFC 4279, RFC 5489).
+	{id: TLS_PSK_WITH_AES_128_CBC_SHA, name: "TLS_PSK_WITH_AES_128_CBC_SHA", keyExchange: "PSK", cipherName: "AES128", macName: "SHA1", keyLen: 16, macLen: 20, ivLen: 16, ka: pskKA, flags: suitePSK, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_PSK_WITH_AES_128_GCM_SHA256, name: "TLS_PSK_WITH_AES_128_GCM_SHA256", keyExchange: "PSK", cipherName: "AES128GCM", keyLen: 16, ivLen: 4, ka: pskKA, flags: suitePSK | suiteTLS12, aead: aeadAESGCM},
+	{id: TLS_PSK_WITH_CHACHA20_POLY1305_SHA256, name: "TLS_PSK_WITH_CHACHA20_POLY1305_SHA256", keyExchange: "PSK", cipherName: "CHACHA20-POLY1305", keyLen: 32, ivLen: 12, ka: pskKA, flags: suitePSK | suiteTLS12, aead: aeadChaCha20Poly1305},
+	{id: TLS_ECDHE_PSK_WITH_AES_128_CBC_SHA, name: "TLS_ECDHE_PSK_WITH_AES_128_CBC_SHA", keyExchange: "ECDHE_PSK", cipherName: "AES128", macName: "SHA1", keyLen: 16, macLen: 20, ivLen: 16, ka: ecdhePSKKA, flags: suiteECDHE | suitePSK, cipher: cipherAES, mac: macSHA1},
+	{id: TLS_ECDHE_PSK_WITH_CHACHA20_POLY1305_SHA256, name: "TLS_ECDHE_PSK_WITH_CHACHA20_POLY1305_SHA256", keyExchange: "ECDHE_PSK", cipherName: "CHACHA20-POLY1305", keyLen: 32, ivLen: 12, ka: ecdhePSKKA, flags: suiteECDHE | suitePSK | suiteTLS12, aead: aeadChaCha20Poly1305},
 }
 
 func cipherRC4(key, iv []byte, isRead bool) interface{} {
@@ -107,6 +174,18 @@ func cipherAES(key, iv []byte, isRead bool) interface{} {
 	return cipher.NewCBCEncrypter(block, iv)
 }
 
+// cipherDES returns a single-DES CBC cipher, used by the 40-bit export
+// suites. The 40-bit key material is carried in an 8-byte DES key (the
+// remaining bits are derived during key expansion); it is only ever as
+// strong as its advertised export grade.
+func cipherDES(key, iv []byte, isRead bool) interface{} {
+	block, _ := des.NewCipher(key)
+	if isRead {
+		return cipher.NewCBCDecrypter(block, iv)
+	}
+	return cipher.NewCBCEncrypter(block, iv)
+}
+
 // macSHA1 returns a macFunction for the given protocol version.
 func macSHA1(version uint16, key []byte) macFunction {
 	if version == VersionSSL30 {
@@ -120,6 +199,20 @@ func macSHA1(version uint16, key []byte) macFunction {
 	return tls10MAC{hmac.New(sha1.New, key)}
 }
 
+// macMD5 returns a macFunction for the given protocol version, used by the
+// older _MD5 export cipher suites.
+func macMD5(version uint16, key []byte) macFunction {
+	if version == VersionSSL30 {
+		mac := ssl30MAC{
+			h:   md5.New(),
+			key: make([]byte, len(key)),
+		}
+		copy(mac.key, key)
+		return mac
+	}
+	return tls10MAC{hmac.New(md5.New, key)}
+}
+
 type macFunction interface {
 	Size() int
 	MAC(digestBuf, seq, header, data []byte) []byte
@@ -165,6 +258,83 @@ func aeadAESGCM(key, fixedNonce []byte) cipher.AEAD {
 	return &fixedNonceAEAD{nonce1, nonce2, aead}
 }
 
+// aeadAESCCM and aeadAESCCM8 build AES-CCM (RFC 7251/7252/7925) with a
+// 16-byte and 8-byte authentication tag respectively. fixedNonceAEAD's
+// Overhead() delegates to the underlying AEAD, so wrapping a ccm whose
+// tagSize is already correctly 8 or 16 is enough to keep the record
+// layer's max-plaintext accounting right for CCM_8 without any further
+// per-suite override.
+func aeadAESCCM(key, fixedNonce []byte) cipher.AEAD {
+	return newFixedNonceCCM(key, fixedNonce, 16)
+}
+
+func aeadAESCCM8(key, fixedNonce []byte) cipher.AEAD {
+	return newFixedNonceCCM(key, fixedNonce, 8)
+}
+
+func newFixedNonceCCM(key, fixedNonce []byte, tagSize int) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := newCCM(block, tagSize)
+	if err != nil {
+		panic(err)
+	}
+
+	nonce1, nonce2 := make([]byte, 12), make([]byte, 12)
+	copy(nonce1, fixedNonce)
+	copy(nonce2, fixedNonce)
+
+	return &fixedNonceAEAD{nonce1, nonce2, aead}
+}
+
+// xorNonceAEAD wraps an AEAD by XORing in the fixed (per-connection) part of
+// the nonce with the 8-byte, left-zero-padded record sequence number, rather
+// than prefixing it as fixedNonceAEAD does. This is the construction used by
+// AEAD_CHACHA20_POLY1305 (RFC 7905): no explicit nonce is transmitted on the
+// wire, so NonceSize still reports 8 to keep the record layer unchanged.
+type xorNonceAEAD struct {
+	nonceMask [12]byte
+	aead      cipher.AEAD
+}
+
+func (f *xorNonceAEAD) NonceSize() int { return 8 }
+func (f *xorNonceAEAD) Overhead() int  { return f.aead.Overhead() }
+
+func (f *xorNonceAEAD) Seal(out, nonce, plaintext, additionalData []byte) []byte {
+	for i, b := range nonce {
+		f.nonceMask[4+i] ^= b
+	}
+	result := f.aead.Seal(out, f.nonceMask[:], plaintext, additionalData)
+	for i, b := range nonce {
+		f.nonceMask[4+i] ^= b
+	}
+	return result
+}
+
+func (f *xorNonceAEAD) Open(out, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	for i, b := range nonce {
+		f.nonceMask[4+i] ^= b
+	}
+	result, err := f.aead.Open(out, f.nonceMask[:], ciphertext, additionalData)
+	for i, b := range nonce {
+		f.nonceMask[4+i] ^= b
+	}
+	return result, err
+}
+
+func aeadChaCha20Poly1305(key, fixedNonce []byte) cipher.AEAD {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		panic(err)
+	}
+
+	nonce := &xorNonceAEAD{aead: aead}
+	copy(nonce.nonceMask[:], fixedNonce)
+	return nonce
+}
+
 // ssl30MAC implements the SSLv3 MAC function, as defined in
 // www.mozilla.org/projects/security/pki/nss/ssl/draft302.txt section 5.2.3.1
 type ssl30MAC struct {
@@ -368,6 +538,30 @@ const (
 	TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256   uint16 = 0xCC13
 )
 
+// AES-CCM ciphers (RFC 6655, RFC 7251). The DHE-RSA-CCM/CCM_8 ids are
+// already declared above, alongside the rest of the DHE ciphers.
+const (
+	TLS_RSA_WITH_AES_128_CCM             uint16 = 0xC09C
+	TLS_RSA_WITH_AES_256_CCM             uint16 = 0xC09D
+	TLS_RSA_WITH_AES_128_CCM_8           uint16 = 0xC0A0
+	TLS_RSA_WITH_AES_256_CCM_8           uint16 = 0xC0A1
+	TLS_ECDHE_ECDSA_WITH_AES_128_CCM     uint16 = 0xC0AC
+	TLS_ECDHE_ECDSA_WITH_AES_256_CCM     uint16 = 0xC0AD
+	TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8   uint16 = 0xC0AE
+	TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8   uint16 = 0xC0AF
+)
+
+// PSK and ECDHE-PSK ciphers (RFC 4279, RFC 5489), useful for scanning
+// EAP/enterprise and IoT TLS endpoints that authenticate with a
+// pre-shared key rather than a certificate.
+const (
+	TLS_PSK_WITH_AES_128_CBC_SHA                uint16 = 0x008C
+	TLS_PSK_WITH_AES_128_GCM_SHA256             uint16 = 0x00A8
+	TLS_PSK_WITH_CHACHA20_POLY1305_SHA256       uint16 = 0xCCAB
+	TLS_ECDHE_PSK_WITH_AES_128_CBC_SHA          uint16 = 0xC035
+	TLS_ECDHE_PSK_WITH_CHACHA20_POLY1305_SHA256 uint16 = 0xCCAC
+)
+
 var DHECiphers []uint16 = []uint16{
 	TLS_DHE_DSS_WITH_DES_CBC_SHA,
 	TLS_DHE_DSS_WITH_3DES_EDE_CBC_SHA,
@@ -545,3 +739,213 @@ var SChannelSuites []uint16 = []uint16{
 	TLS_RSA_WITH_AES_128_GCM_SHA256,
 	TLS_RSA_WITH_RC4_128_SHA,
 }
+
+// CCMCiphers is a preference list of the AES-CCM suites, the standard AEAD
+// for constrained IoT/DTLS deployments.
+var CCMCiphers []uint16 = []uint16{
+	TLS_ECDHE_ECDSA_WITH_AES_128_CCM,
+	TLS_ECDHE_ECDSA_WITH_AES_256_CCM,
+	TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8,
+	TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8,
+	TLS_DHE_RSA_WITH_AES_128_CCM,
+	TLS_DHE_RSA_WITH_AES_256_CCM,
+	TLS_DHE_RSA_WITH_AES_128_CCM_8,
+	TLS_DHE_RSA_WITH_AES_256_CCM_8,
+	TLS_RSA_WITH_AES_128_CCM,
+	TLS_RSA_WITH_AES_256_CCM,
+	TLS_RSA_WITH_AES_128_CCM_8,
+	TLS_RSA_WITH_AES_256_CCM_8,
+}
+
+// PSKCiphers is a preference list of the PSK and ECDHE-PSK suites, useful
+// for scanning EAP/enterprise and IoT TLS endpoints.
+var PSKCiphers []uint16 = []uint16{
+	TLS_ECDHE_PSK_WITH_CHACHA20_POLY1305_SHA256,
+	TLS_ECDHE_PSK_WITH_AES_128_CBC_SHA,
+	TLS_PSK_WITH_CHACHA20_POLY1305_SHA256,
+	TLS_PSK_WITH_AES_128_GCM_SHA256,
+	TLS_PSK_WITH_AES_128_CBC_SHA,
+}
+
+// cipherSuiteNames maps every cipher suite ID constant declared in this
+// file to its IANA name, including suites this package doesn't implement a
+// handshake for (e.g. TLS_DHE_DSS_*, KRB5, EXPORT1024, CAMELLIA, ARIA),
+// purely so that CipherSuiteName can still report a symbolic name for
+// unimplemented suites a scan happens to observe. cipherSuites remains the
+// single source of truth for the suites this package can actually
+// negotiate (and their keyLen/cipher/mac/etc. metadata); this map only
+// ever needs to grow in step with the id constants above, not with
+// cipherSuites.
+var cipherSuiteNames = map[uint16]string{
+	0x0005: "TLS_RSA_WITH_RC4_128_SHA",
+	0x000a: "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	0x002f: "TLS_RSA_WITH_AES_128_CBC_SHA",
+	0x0035: "TLS_RSA_WITH_AES_256_CBC_SHA",
+	0x009C: "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	0xc007: "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	0xc009: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	0xc00a: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	0xc011: "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	0xc012: "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	0xc013: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	0xc014: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	0xc02f: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	0xc02b: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	0x0004: "TLS_RSA_WITH_RC4_128_MD5",
+	0x0003: "TLS_RSA_EXPORT_WITH_RC4_40_MD5",
+	0x0006: "TLS_RSA_EXPORT_WITH_RC2_CBC_40_MD5",
+	0x0008: "TLS_RSA_EXPORT_WITH_DES40_CBC_SHA",
+	0x000B: "TLS_DH_DSS_EXPORT_WITH_DES40_CBC_SHA",
+	0x000E: "TLS_DH_RSA_EXPORT_WITH_DES40_CBC_SHA",
+	0x0011: "TLS_DHE_DSS_EXPORT_WITH_DES40_CBC_SHA",
+	0x0014: "TLS_DHE_RSA_EXPORT_WITH_DES40_CBC_SHA",
+	0x0017: "TLS_DH_anon_EXPORT_WITH_RC4_40_MD5",
+	0x0019: "TLS_DH_anon_EXPORT_WITH_DES40_CBC_SHA",
+	0x0026: "TLS_KRB5_EXPORT_WITH_DES_CBC_40_SHA",
+	0x0027: "TLS_KRB5_EXPORT_WITH_RC2_CBC_40_SHA",
+	0x0028: "TLS_KRB5_EXPORT_WITH_RC4_40_SHA",
+	0x0029: "TLS_KRB5_EXPORT_WITH_DES_CBC_40_MD5",
+	0x002A: "TLS_KRB5_EXPORT_WITH_RC2_CBC_40_MD5",
+	0x002B: "TLS_KRB5_EXPORT_WITH_RC4_40_MD5",
+	0x0060: "TLS_RSA_EXPORT1024_WITH_RC4_56_MD5",
+	0x0061: "TLS_RSA_EXPORT1024_WITH_RC2_CBC_56_MD5",
+	0x0062: "TLS_RSA_EXPORT1024_WITH_DES_CBC_SHA",
+	0x0063: "TLS_DHE_DSS_EXPORT1024_WITH_DES_CBC_SHA",
+	0x0064: "TLS_RSA_EXPORT1024_WITH_RC4_56_SHA",
+	0x0065: "TLS_DHE_DSS_EXPORT1024_WITH_RC4_56_SHA",
+	0x0012: "TLS_DHE_DSS_WITH_DES_CBC_SHA",
+	0x0013: "TLS_DHE_DSS_WITH_3DES_EDE_CBC_SHA",
+	0x0015: "TLS_DHE_RSA_WITH_DES_CBC_SHA",
+	0x0016: "TLS_DHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	0x0032: "TLS_DHE_DSS_WITH_AES_128_CBC_SHA",
+	0x0033: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA",
+	0x0038: "TLS_DHE_DSS_WITH_AES_256_CBC_SHA",
+	0x0039: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA",
+	0x0040: "TLS_DHE_DSS_WITH_AES_128_CBC_SHA256",
+	0x0044: "TLS_DHE_DSS_WITH_CAMELLIA_128_CBC_SHA",
+	0x0045: "TLS_DHE_RSA_WITH_CAMELLIA_128_CBC_SHA",
+	0x0066: "TLS_DHE_DSS_WITH_RC4_128_SHA",
+	0x0067: "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256",
+	0x006A: "TLS_DHE_DSS_WITH_AES_256_CBC_SHA256",
+	0x006B: "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256",
+	0x0087: "TLS_DHE_DSS_WITH_CAMELLIA_256_CBC_SHA",
+	0x0088: "TLS_DHE_RSA_WITH_CAMELLIA_256_CBC_SHA",
+	0x0099: "TLS_DHE_DSS_WITH_SEED_CBC_SHA",
+	0x009A: "TLS_DHE_RSA_WITH_SEED_CBC_SHA",
+	0x009E: "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256",
+	0x009F: "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384",
+	0x00A2: "TLS_DHE_DSS_WITH_AES_128_GCM_SHA256",
+	0x00A3: "TLS_DHE_DSS_WITH_AES_256_GCM_SHA384",
+	0x00BD: "TLS_DHE_DSS_WITH_CAMELLIA_128_CBC_SHA256",
+	0x00BE: "TLS_DHE_RSA_WITH_CAMELLIA_128_CBC_SHA256",
+	0x00C3: "TLS_DHE_DSS_WITH_CAMELLIA_256_CBC_SHA256",
+	0x00C4: "TLS_DHE_RSA_WITH_CAMELLIA_256_CBC_SHA256",
+	0xC042: "TLS_DHE_DSS_WITH_ARIA_128_CBC_SHA256",
+	0xC043: "TLS_DHE_DSS_WITH_ARIA_256_CBC_SHA384",
+	0xC044: "TLS_DHE_RSA_WITH_ARIA_128_CBC_SHA256",
+	0xC045: "TLS_DHE_RSA_WITH_ARIA_256_CBC_SHA384",
+	0xC052: "TLS_DHE_RSA_WITH_ARIA_128_GCM_SHA256",
+	0xC053: "TLS_DHE_RSA_WITH_ARIA_256_GCM_SHA384",
+	0xC056: "TLS_DHE_DSS_WITH_ARIA_128_GCM_SHA256",
+	0xC057: "TLS_DHE_DSS_WITH_ARIA_256_GCM_SHA384",
+	0xC07C: "TLS_DHE_RSA_WITH_CAMELLIA_128_GCM_SHA256",
+	0xC07D: "TLS_DHE_RSA_WITH_CAMELLIA_256_GCM_SHA384",
+	0xC080: "TLS_DHE_DSS_WITH_CAMELLIA_128_GCM_SHA256",
+	0xC081: "TLS_DHE_DSS_WITH_CAMELLIA_256_GCM_SHA384",
+	0xC09E: "TLS_DHE_RSA_WITH_AES_128_CCM",
+	0xC09F: "TLS_DHE_RSA_WITH_AES_256_CCM",
+	0xC0A2: "TLS_DHE_RSA_WITH_AES_128_CCM_8",
+	0xC0A3: "TLS_DHE_RSA_WITH_AES_256_CCM_8",
+	0xCC15: "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xCC14: "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xCC13: "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xC09C: "TLS_RSA_WITH_AES_128_CCM",
+	0xC09D: "TLS_RSA_WITH_AES_256_CCM",
+	0xC0A0: "TLS_RSA_WITH_AES_128_CCM_8",
+	0xC0A1: "TLS_RSA_WITH_AES_256_CCM_8",
+	0xC0AC: "TLS_ECDHE_ECDSA_WITH_AES_128_CCM",
+	0xC0AD: "TLS_ECDHE_ECDSA_WITH_AES_256_CCM",
+	0xC0AE: "TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8",
+	0xC0AF: "TLS_ECDHE_ECDSA_WITH_AES_256_CCM_8",
+	0x008C: "TLS_PSK_WITH_AES_128_CBC_SHA",
+	0x00A8: "TLS_PSK_WITH_AES_128_GCM_SHA256",
+	0xCCAB: "TLS_PSK_WITH_CHACHA20_POLY1305_SHA256",
+	0xC035: "TLS_ECDHE_PSK_WITH_AES_128_CBC_SHA",
+	0xCCAC: "TLS_ECDHE_PSK_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+// CipherSuiteName returns the IANA name of the cipher suite with the given
+// ID, or a descriptive placeholder (e.g. "0x1234") if the ID is unknown to
+// this package. It consults cipherSuiteNames rather than cipherSuites so
+// that suites this package declares but doesn't negotiate (e.g.
+// TLS_DHE_DSS_*) still resolve to a symbolic name instead of a bare hex
+// value.
+func CipherSuiteName(id uint16) string {
+	if name, ok := cipherSuiteNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
+// CipherSuite is the metadata exposed for a cipher suite this package can
+// negotiate, following the shape of crypto/tls.CipherSuite.
+type CipherSuite struct {
+	ID                uint16
+	Name              string
+	SupportedVersions []uint16
+	Insecure          bool
+	KeyExchange       string
+	Cipher            string
+	MAC               string
+}
+
+// supportedVersions reports the protocol versions a suite is eligible for.
+// Suites explicitly marked suiteTLS12 are TLS 1.2 only, as are AEAD suites
+// regardless of whether suiteTLS12 was also set on them: TLS 1.2 is what
+// introduced AEAD record protection, so an AEAD suite can never actually be
+// negotiated below it. Everything else (the historical SSLv3/TLS1.0-1.2
+// suites) is negotiable down to SSLv3.
+func (c *cipherSuite) supportedVersions() []uint16 {
+	if c.flags&suiteTLS12 != 0 || c.aead != nil {
+		return []uint16{VersionTLS12}
+	}
+	return []uint16{VersionSSL30, VersionTLS10, VersionTLS11, VersionTLS12}
+}
+
+func toPublicCipherSuite(c *cipherSuite) *CipherSuite {
+	return &CipherSuite{
+		ID:                c.id,
+		Name:              c.name,
+		SupportedVersions: c.supportedVersions(),
+		Insecure:          c.insecure,
+		KeyExchange:       c.keyExchange,
+		Cipher:            c.cipherName,
+		MAC:               c.macName,
+	}
+}
+
+// CipherSuites returns a list of cipher suites currently implemented by
+// this package, excluding those with security issues, which are returned
+// by InsecureCipherSuites.
+func CipherSuites() []*CipherSuite {
+	suites := make([]*CipherSuite, 0, len(cipherSuites))
+	for _, c := range cipherSuites {
+		if c.insecure {
+			continue
+		}
+		suites = append(suites, toPublicCipherSuite(c))
+	}
+	return suites
+}
+
+// InsecureCipherSuites returns a list of cipher suites currently
+// implemented by this package and which have security issues.
+func InsecureCipherSuites() []*CipherSuite {
+	suites := make([]*CipherSuite, 0)
+	for _, c := range cipherSuites {
+		if c.insecure {
+			suites = append(suites, toPublicCipherSuite(c))
+		}
+	}
+	return suites
+}
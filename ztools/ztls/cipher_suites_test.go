@@ -0,0 +1,115 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ztls
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestChaCha20Poly1305CipherSuitesRegistered checks that the ChaCha20
+// suites referenced by ChromeCiphers are actually registered in
+// cipherSuites with the right metadata, so that a scan advertising them
+// can negotiate and later report on them. A full handshake against a live
+// server (e.g. cloudflare) isn't exercisable in this test environment, so
+// this covers what's reachable without a network: suite lookup, name
+// resolution and the TLS-1.2-only version reporting an AEAD suite should
+// get.
+func TestChaCha20Poly1305CipherSuitesRegistered(t *testing.T) {
+	cases := []struct {
+		id   uint16
+		name string
+	}{
+		{TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+		{TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"},
+		{TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256, "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+	}
+
+	for _, c := range cases {
+		var suite *cipherSuite
+		for _, s := range cipherSuites {
+			if s.id == c.id {
+				suite = s
+				break
+			}
+		}
+		if suite == nil {
+			t.Errorf("suite 0x%04X not registered in cipherSuites", c.id)
+			continue
+		}
+		if suite.aead == nil {
+			t.Errorf("suite %s: expected an AEAD constructor, got nil", c.name)
+		}
+		if got := CipherSuiteName(c.id); got != c.name {
+			t.Errorf("CipherSuiteName(0x%04X) = %q, want %q", c.id, got, c.name)
+		}
+		versions := suite.supportedVersions()
+		if len(versions) != 1 || versions[0] != VersionTLS12 {
+			t.Errorf("suite %s: supportedVersions() = %v, want [TLS 1.2 only]", c.name, versions)
+		}
+	}
+}
+
+// TestXorNonceAEAD checks the RFC 7905 nonce construction: Seal followed by
+// Open with the same record sequence number round-trips, and the fixed
+// nonce mask is restored after each call so it can be reused for the next
+// record.
+func TestXorNonceAEAD(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	fixedNonce := make([]byte, 12)
+	for i := range fixedNonce {
+		fixedNonce[i] = byte(0xA0 + i)
+	}
+
+	aead := aeadChaCha20Poly1305(key, fixedNonce)
+
+	seq := make([]byte, 8)
+	seq[7] = 1 // record sequence number 1, left-padded to 8 bytes per RFC 7905
+
+	plaintext := []byte("the quick brown fox")
+	additionalData := []byte("header")
+
+	ciphertext := aead.Seal(nil, seq, plaintext, additionalData)
+	if bytes.Equal(ciphertext, plaintext) {
+		t.Fatal("Seal did not appear to encrypt the plaintext")
+	}
+
+	got, err := aead.Open(nil, seq, ciphertext, additionalData)
+	if err != nil {
+		t.Fatalf("Open failed on matching nonce/aad: %s", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("Open returned %q, want %q", got, plaintext)
+	}
+
+	// A different sequence number must not decrypt to the same plaintext.
+	seq[7] = 2
+	if _, err := aead.Open(nil, seq, ciphertext, additionalData); err == nil {
+		t.Fatal("Open succeeded with the wrong sequence number")
+	}
+}
+
+// TestDHEChaCha20Poly1305WiredToDHEKeyAgreement confirms that
+// TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256 is registered and that its key
+// agreement constructor yields the DHE key agreement; it does not run a
+// live handshake.
+func TestDHEChaCha20Poly1305WiredToDHEKeyAgreement(t *testing.T) {
+	for _, s := range cipherSuites {
+		if s.id != TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256 {
+			continue
+		}
+		if s.ka == nil {
+			t.Fatal("TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256 has no key agreement constructor")
+		}
+		if _, ok := s.ka(VersionTLS12).(*dheKeyAgreement); !ok {
+			t.Fatal("TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256 is not wired to the DHE key agreement")
+		}
+		return
+	}
+	t.Fatal("TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256 not registered in cipherSuites")
+}
@@ -0,0 +1,37 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ztls
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// Config carries the subset of connection configuration the PSK key
+// agreements in this package need (the rest of the handshake-level Config
+// lives alongside the handshake driver, outside this package).
+type Config struct {
+	// Rand provides the source of entropy for the handshake. If nil,
+	// crypto/rand.Reader is used.
+	Rand io.Reader
+
+	// PSKIdentity and PSKKey are the identity/key pair presented for the
+	// plain PSK and ECDHE-PSK cipher suites (RFC 4279, RFC 5489) when
+	// PSKCallback is nil.
+	PSKIdentity string
+	PSKKey      []byte
+
+	// PSKCallback, if set, is consulted instead of PSKIdentity/PSKKey,
+	// and is passed the server's identity_hint (which may be empty) so
+	// that the identity/key returned can depend on it.
+	PSKCallback func(hint string) (identity string, key []byte)
+}
+
+func (c *Config) rand() io.Reader {
+	if c.Rand != nil {
+		return c.Rand
+	}
+	return rand.Reader
+}
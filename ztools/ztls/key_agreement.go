@@ -0,0 +1,382 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ztls
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/zmap/zgrab/ztools/x509"
+)
+
+var errServerKeyExchange = errors.New("invalid ServerKeyExchange message")
+
+// lookupTLSHash maps a TLS 1.2 HashAlgorithm identifier (RFC 5246 section
+// 7.4.1.4.1) to the corresponding crypto.Hash.
+func lookupTLSHash(id byte) (crypto.Hash, error) {
+	switch id {
+	case 1:
+		return crypto.MD5, nil
+	case 2:
+		return crypto.SHA1, nil
+	case 3:
+		return crypto.SHA224, nil
+	case 4:
+		return crypto.SHA256, nil
+	case 5:
+		return crypto.SHA384, nil
+	case 6:
+		return crypto.SHA512, nil
+	}
+	return 0, errors.New("ztls: unsupported hash algorithm in ServerKeyExchange signature")
+}
+
+// DHParams records the ephemeral Diffie-Hellman parameters offered by a
+// server during a TLS_DHE_* handshake, so that large-scale scans can later
+// identify weak or well-known groups (e.g. for Logjam measurement). It is
+// attached to the handshake log alongside the rest of the ServerKeyExchange.
+type DHParams struct {
+	Prime        *big.Int `json:"prime,omitempty"`
+	Generator    *big.Int `json:"generator,omitempty"`
+	ServerPublic *big.Int `json:"server_public,omitempty"`
+}
+
+// dheKeyAgreement implements the plain (non-elliptic-curve) Diffie-Hellman
+// key exchange used by the TLS_DHE_RSA_* cipher suites. The
+// ServerKeyExchange carries the group (p, g) and the server's ephemeral
+// public value Ys, signed over ClientHello.random || ServerHello.random ||
+// ServerParams with the server's RSA key. (TLS_DHE_DSS_* suites also use
+// this message shape, signed with DSA instead, but this package does not
+// implement DSA signature verification, so no dheDSSKA constructor is
+// registered -- see cipher_suites.go.)
+type dheKeyAgreement struct {
+	sigType uint8
+	version uint16
+
+	p, g, yServer *big.Int
+
+	// params records the ephemeral parameters offered by the server so
+	// that they can be surfaced in the handshake log.
+	params DHParams
+}
+
+func dheRSAKA(version uint16) keyAgreement {
+	return &dheKeyAgreement{sigType: signatureRSA, version: version}
+}
+
+// processServerKeyExchange parses p, g and Ys out of the ServerKeyExchange,
+// verifies the signature over the two client/server randoms and the DH
+// params, and records the group for later use (and logging).
+func (ka *dheKeyAgreement) processServerKeyExchange(config *Config, clientHello *clientHelloMsg, serverHello *serverHelloMsg, cert *x509.Certificate, skx *serverKeyExchangeMsg) error {
+	if len(skx.key) < 2 {
+		return errServerKeyExchange
+	}
+	data := skx.key
+
+	p, data, err := readDHParam(data)
+	if err != nil {
+		return errServerKeyExchange
+	}
+	g, data, err := readDHParam(data)
+	if err != nil {
+		return errServerKeyExchange
+	}
+	ys, data, err := readDHParam(data)
+	if err != nil {
+		return errServerKeyExchange
+	}
+	if p.Sign() == 0 || g.Sign() == 0 || ys.Sign() == 0 {
+		return errServerKeyExchange
+	}
+
+	ka.p = p
+	ka.g = g
+	ka.yServer = ys
+	ka.params = DHParams{Prime: p, Generator: g, ServerPublic: ys}
+
+	paramsLen := len(skx.key) - len(data)
+	params := skx.key[:paramsLen]
+
+	// TLS 1.2 prefixes the signature with a 2-byte SignatureAndHashAlgorithm
+	// (RFC 5246 section 7.4.1.4.1); earlier versions always sign with
+	// MD5+SHA1 and carry no such prefix.
+	hashFunc := crypto.Hash(0)
+	if ka.version >= VersionTLS12 {
+		if len(data) < 2 {
+			return errServerKeyExchange
+		}
+		var err error
+		hashFunc, err = lookupTLSHash(data[0])
+		if err != nil {
+			return err
+		}
+		data = data[2:]
+	}
+
+	if len(data) < 2 {
+		return errServerKeyExchange
+	}
+	sigLen := int(data[0])<<8 | int(data[1])
+	data = data[2:]
+	if len(data) != sigLen {
+		return errServerKeyExchange
+	}
+	sig := data
+
+	switch ka.sigType {
+	case signatureRSA:
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("signing certificate does not contain an RSA public key")
+		}
+		return verifyRSAParamsSignature(pub, hashFunc, ka.version, clientHello.random, serverHello.random, params, sig)
+	}
+	return errors.New("unknown signature algorithm")
+}
+
+// verifyRSAParamsSignature checks an RSA digitally-signed ServerKeyExchange
+// signature over ClientHello.random || ServerHello.random || ServerParams:
+// the negotiated hash for TLS 1.2 (hashFunc, already parsed out of the
+// SignatureAndHashAlgorithm prefix by the caller), or MD5(16)||SHA1(20)
+// concatenated with no DigestInfo wrapper for TLS 1.0/1.1. Used by both
+// dheKeyAgreement and rsaExportKeyAgreement, whose ServerKeyExchange
+// messages share this same signature suffix.
+func verifyRSAParamsSignature(pub *rsa.PublicKey, hashFunc crypto.Hash, version uint16, clientRandom, serverRandom, params, sig []byte) error {
+	if version >= VersionTLS12 {
+		h := hashFunc.New()
+		h.Write(clientRandom)
+		h.Write(serverRandom)
+		h.Write(params)
+		return rsa.VerifyPKCS1v15(pub, hashFunc, h.Sum(nil), sig)
+	}
+	// TLS 1.0/1.1 signs MD5(16)||SHA1(20) with no DigestInfo wrapper.
+	md5h := md5.New()
+	md5h.Write(clientRandom)
+	md5h.Write(serverRandom)
+	md5h.Write(params)
+	sha1h := sha1.New()
+	sha1h.Write(clientRandom)
+	sha1h.Write(serverRandom)
+	sha1h.Write(params)
+	digest := md5h.Sum(nil)
+	digest = sha1h.Sum(digest)
+	return rsa.VerifyPKCS1v15(pub, crypto.Hash(0), digest, sig)
+}
+
+// generateClientKeyExchange picks a private exponent, computes the
+// corresponding public value Yc and the premaster secret g^(xc*xs) mod p,
+// and returns a ClientKeyExchange carrying Yc as an opaque<1..2^16-1>.
+func (ka *dheKeyAgreement) generateClientKeyExchange(config *Config, clientHello *clientHelloMsg, cert *x509.Certificate, version uint16) ([]byte, *clientKeyExchangeMsg, error) {
+	if ka.p == nil || ka.g == nil || ka.yServer == nil {
+		return nil, nil, errors.New("missing ServerKeyExchange message")
+	}
+
+	xc, err := rand.Int(config.rand(), ka.p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	yc := new(big.Int).Exp(ka.g, xc, ka.p)
+	preMasterSecret := new(big.Int).Exp(ka.yServer, xc, ka.p).Bytes()
+
+	ckx := new(clientKeyExchangeMsg)
+	ycBytes := yc.Bytes()
+	ckx.ciphertext = make([]byte, len(ycBytes)+2)
+	ckx.ciphertext[0] = byte(len(ycBytes) >> 8)
+	ckx.ciphertext[1] = byte(len(ycBytes))
+	copy(ckx.ciphertext[2:], ycBytes)
+
+	return preMasterSecret, ckx, nil
+}
+
+// generateServerKeyExchange and processClientKeyExchange are the server side
+// of the exchange. zgrab only ever drives the client side of a handshake, so
+// both exist only to satisfy keyAgreement and always return an error.
+func (ka *dheKeyAgreement) generateServerKeyExchange(config *Config, cert *Certificate, clientHello *clientHelloMsg, serverHello *serverHelloMsg) (*serverKeyExchangeMsg, error) {
+	return nil, errors.New("ztls: DHE server-side key exchange is not supported")
+}
+
+func (ka *dheKeyAgreement) processClientKeyExchange(config *Config, cert *Certificate, ckx *clientKeyExchangeMsg, version uint16) ([]byte, error) {
+	return nil, errors.New("ztls: DHE server-side key exchange is not supported")
+}
+
+// RSAParams records the ephemeral RSA key a server offered during a
+// TLS_RSA_EXPORT_* handshake, so that large-scale scans can later identify
+// weak or reused 512-bit keys (e.g. for FREAK measurement). It is attached
+// to the handshake log alongside the rest of the ServerKeyExchange.
+type RSAParams struct {
+	Modulus  *big.Int `json:"modulus,omitempty"`
+	Exponent *big.Int `json:"exponent,omitempty"`
+}
+
+// rsaExportKeyAgreement implements the TLS_RSA_EXPORT_* cipher suites. The
+// server's long-term RSA certificate is too strong to export, so it instead
+// signs a temporary, export-strength (512-bit) RSA key and sends it in a
+// ServerKeyExchange; the client encrypts the premaster secret with that
+// ephemeral key rather than the certificate's.
+type rsaExportKeyAgreement struct {
+	sigType uint8
+	version uint16
+
+	modulus, exponent *big.Int
+
+	// params records the ephemeral key offered by the server so that it
+	// can be surfaced in the handshake log.
+	params RSAParams
+}
+
+// processServerKeyExchange parses the ephemeral RSA modulus and exponent
+// out of the ServerKeyExchange (RFC 2246 section 7.4.3: rsa_modulus and
+// rsa_exponent, encoded exactly like the DHE params above) and verifies the
+// signature over the two client/server randoms and the key, made with the
+// server's long-term certificate key.
+func (ka *rsaExportKeyAgreement) processServerKeyExchange(config *Config, clientHello *clientHelloMsg, serverHello *serverHelloMsg, cert *x509.Certificate, skx *serverKeyExchangeMsg) error {
+	if len(skx.key) < 2 {
+		return errServerKeyExchange
+	}
+	data := skx.key
+
+	modulus, data, err := readDHParam(data)
+	if err != nil {
+		return errServerKeyExchange
+	}
+	exponent, data, err := readDHParam(data)
+	if err != nil {
+		return errServerKeyExchange
+	}
+	if modulus.Sign() == 0 || exponent.Sign() == 0 {
+		return errServerKeyExchange
+	}
+
+	ka.modulus = modulus
+	ka.exponent = exponent
+	ka.params = RSAParams{Modulus: modulus, Exponent: exponent}
+
+	paramsLen := len(skx.key) - len(data)
+	params := skx.key[:paramsLen]
+
+	// TLS 1.2 prefixes the signature with a 2-byte SignatureAndHashAlgorithm
+	// (RFC 5246 section 7.4.1.4.1); earlier versions always sign with
+	// MD5+SHA1 and carry no such prefix.
+	hashFunc := crypto.Hash(0)
+	if ka.version >= VersionTLS12 {
+		if len(data) < 2 {
+			return errServerKeyExchange
+		}
+		var err error
+		hashFunc, err = lookupTLSHash(data[0])
+		if err != nil {
+			return err
+		}
+		data = data[2:]
+	}
+
+	if len(data) < 2 {
+		return errServerKeyExchange
+	}
+	sigLen := int(data[0])<<8 | int(data[1])
+	data = data[2:]
+	if len(data) != sigLen {
+		return errServerKeyExchange
+	}
+	sig := data
+
+	switch ka.sigType {
+	case signatureRSA:
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("signing certificate does not contain an RSA public key")
+		}
+		return verifyRSAParamsSignature(pub, hashFunc, ka.version, clientHello.random, serverHello.random, params, sig)
+	}
+	return errors.New("unknown signature algorithm")
+}
+
+// generateClientKeyExchange encrypts a freshly generated premaster secret
+// under the server's ephemeral export-strength RSA key and returns it as an
+// opaque<1..2^16-1>, as for the non-export RSA key exchange.
+func (ka *rsaExportKeyAgreement) generateClientKeyExchange(config *Config, clientHello *clientHelloMsg, cert *x509.Certificate, version uint16) ([]byte, *clientKeyExchangeMsg, error) {
+	if ka.modulus == nil || ka.exponent == nil {
+		return nil, nil, errors.New("missing ServerKeyExchange message")
+	}
+
+	preMasterSecret := make([]byte, 48)
+	preMasterSecret[0] = byte(clientHello.vers >> 8)
+	preMasterSecret[1] = byte(clientHello.vers)
+	if _, err := io.ReadFull(config.rand(), preMasterSecret[2:]); err != nil {
+		return nil, nil, err
+	}
+
+	pub := &rsa.PublicKey{N: ka.modulus, E: int(ka.exponent.Int64())}
+	encrypted, err := rsa.EncryptPKCS1v15(config.rand(), pub, preMasterSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ckx := new(clientKeyExchangeMsg)
+	ckx.ciphertext = appendUint16Opaque(nil, encrypted)
+	return preMasterSecret, ckx, nil
+}
+
+// generateServerKeyExchange and processClientKeyExchange are the server side
+// of the exchange. zgrab only ever drives the client side of a handshake, so
+// both exist only to satisfy keyAgreement and always return an error.
+func (ka *rsaExportKeyAgreement) generateServerKeyExchange(config *Config, cert *Certificate, clientHello *clientHelloMsg, serverHello *serverHelloMsg) (*serverKeyExchangeMsg, error) {
+	return nil, errors.New("ztls: RSA-export server-side key exchange is not supported")
+}
+
+func (ka *rsaExportKeyAgreement) processClientKeyExchange(config *Config, cert *Certificate, ckx *clientKeyExchangeMsg, version uint16) ([]byte, error) {
+	return nil, errors.New("ztls: RSA-export server-side key exchange is not supported")
+}
+
+// ServerKeyExchangeLog is the handshake-log representation of a
+// ServerKeyExchange message: whatever extra data a keyAgreement captured
+// while processing it that's worth recording for scan analysis, beyond
+// what's needed to complete the handshake itself.
+type ServerKeyExchangeLog struct {
+	*DHParams  `json:",omitempty"`
+	*RSAParams `json:",omitempty"`
+
+	PSKIdentityHint string `json:"psk_identity_hint,omitempty"`
+}
+
+// ServerKeyExchangeLog implements an optional interface the handshake
+// client checks for after a successful processServerKeyExchange, so that
+// the ephemeral DH group a server offered can be attached to the
+// handshake log (useful for FREAK/Logjam-style measurement).
+func (ka *dheKeyAgreement) ServerKeyExchangeLog() *ServerKeyExchangeLog {
+	return &ServerKeyExchangeLog{DHParams: &ka.params}
+}
+
+// ServerKeyExchangeLog implements an optional interface the handshake
+// client checks for after a successful processServerKeyExchange, so that
+// the ephemeral RSA key a server offered can be attached to the handshake
+// log (useful for FREAK-style measurement).
+func (ka *rsaExportKeyAgreement) ServerKeyExchangeLog() *ServerKeyExchangeLog {
+	return &ServerKeyExchangeLog{RSAParams: &ka.params}
+}
+
+// readDHParam reads a big-endian, uint16-length-prefixed integer off the
+// front of data, as used for p, g and Ys (and Yc) in the DHE messages.
+func readDHParam(data []byte) (param *big.Int, rest []byte, err error) {
+	if len(data) < 2 {
+		return nil, nil, errServerKeyExchange
+	}
+	paramLen := int(data[0])<<8 | int(data[1])
+	data = data[2:]
+	if len(data) < paramLen {
+		return nil, nil, errServerKeyExchange
+	}
+	param = new(big.Int).SetBytes(data[:paramLen])
+	return param, data[paramLen:], nil
+}
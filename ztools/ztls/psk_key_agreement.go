@@ -0,0 +1,214 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ztls
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+
+	"github.com/zmap/zgrab/ztools/x509"
+)
+
+// curveForCurveID maps a TLS NamedCurve identifier (RFC 4492 section 5.1.1)
+// to the corresponding elliptic.Curve, for the handful of curves zgrab
+// negotiates.
+func curveForCurveID(id uint16) (elliptic.Curve, bool) {
+	switch id {
+	case 23:
+		return elliptic.P256(), true
+	case 24:
+		return elliptic.P384(), true
+	case 25:
+		return elliptic.P521(), true
+	}
+	return nil, false
+}
+
+// pskPremaster builds the premaster secret of the PSK suites:
+// uint16(len(other))||other||uint16(len(psk))||psk. For plain PSK (RFC 4279
+// section 2) other is the all-zero string of the same length as psk; for
+// ECDHE-PSK (RFC 5489 section 2) it is the ECDHE shared secret Z.
+func pskPremaster(other, psk []byte) []byte {
+	out := make([]byte, 0, 4+len(other)+len(psk))
+	out = appendUint16Opaque(out, other)
+	out = appendUint16Opaque(out, psk)
+	return out
+}
+
+func appendUint16Opaque(out, data []byte) []byte {
+	out = append(out, byte(len(data)>>8), byte(len(data)))
+	return append(out, data...)
+}
+
+// pskKey returns the identity/key pair to present for this connection,
+// preferring a caller-supplied callback (keyed off the server's
+// identity_hint) over a fixed identity/key pair.
+func pskKey(config *Config, hint string) (identity string, key []byte) {
+	if config.PSKCallback != nil {
+		return config.PSKCallback(hint)
+	}
+	return config.PSKIdentity, config.PSKKey
+}
+
+// pskKeyAgreement implements the plain (non-ECDHE) PSK suites of RFC 4279.
+// The ServerKeyExchange, if sent, carries only an identity hint; there is
+// no other key material to agree on.
+type pskKeyAgreement struct {
+	identityHint string
+}
+
+func pskKA(version uint16) keyAgreement {
+	return &pskKeyAgreement{}
+}
+
+func (ka *pskKeyAgreement) processServerKeyExchange(config *Config, clientHello *clientHelloMsg, serverHello *serverHelloMsg, cert *x509.Certificate, skx *serverKeyExchangeMsg) error {
+	hint, _, err := readUint16Opaque(skx.key)
+	if err != nil {
+		return errServerKeyExchange
+	}
+	ka.identityHint = string(hint)
+	return nil
+}
+
+// ServerKeyExchangeLog reports the identity hint the server sent, so that
+// scans can record which PSK identity a server expects without mutating
+// the shared Config.
+func (ka *pskKeyAgreement) ServerKeyExchangeLog() *ServerKeyExchangeLog {
+	return &ServerKeyExchangeLog{PSKIdentityHint: ka.identityHint}
+}
+
+func (ka *pskKeyAgreement) generateClientKeyExchange(config *Config, clientHello *clientHelloMsg, cert *x509.Certificate, version uint16) ([]byte, *clientKeyExchangeMsg, error) {
+	identity, key := pskKey(config, ka.identityHint)
+	if len(key) == 0 {
+		return nil, nil, errors.New("ztls: no PSK configured for PSK cipher suite")
+	}
+
+	preMasterSecret := pskPremaster(make([]byte, len(key)), key)
+
+	ckx := new(clientKeyExchangeMsg)
+	ckx.ciphertext = appendUint16Opaque(nil, []byte(identity))
+	return preMasterSecret, ckx, nil
+}
+
+func (ka *pskKeyAgreement) generateServerKeyExchange(config *Config, cert *Certificate, clientHello *clientHelloMsg, serverHello *serverHelloMsg) (*serverKeyExchangeMsg, error) {
+	return nil, errors.New("ztls: PSK server-side key exchange is not supported")
+}
+
+func (ka *pskKeyAgreement) processClientKeyExchange(config *Config, cert *Certificate, ckx *clientKeyExchangeMsg, version uint16) ([]byte, error) {
+	return nil, errors.New("ztls: PSK server-side key exchange is not supported")
+}
+
+// ecdhePSKKeyAgreement implements the ECDHE-PSK suites of RFC 5489: the
+// ServerKeyExchange carries an identity hint followed by the usual ECDHE
+// ServerECDHParams (curve and public point, unsigned -- PSK suites
+// authenticate via the shared secret, not a certificate).
+type ecdhePSKKeyAgreement struct {
+	identityHint string
+	curve        elliptic.Curve
+	x, y         *big.Int
+	privateKey   []byte
+}
+
+func ecdhePSKKA(version uint16) keyAgreement {
+	return &ecdhePSKKeyAgreement{}
+}
+
+func (ka *ecdhePSKKeyAgreement) processServerKeyExchange(config *Config, clientHello *clientHelloMsg, serverHello *serverHelloMsg, cert *x509.Certificate, skx *serverKeyExchangeMsg) error {
+	hint, data, err := readUint16Opaque(skx.key)
+	if err != nil {
+		return errServerKeyExchange
+	}
+	ka.identityHint = string(hint)
+
+	if len(data) < 4 {
+		return errServerKeyExchange
+	}
+	if data[0] != 3 { // named_curve
+		return errors.New("ztls: server selected unsupported ECDHE-PSK curve type")
+	}
+	curveID := uint16(data[1])<<8 | uint16(data[2])
+	curve, ok := curveForCurveID(curveID)
+	if !ok {
+		return errors.New("ztls: server selected unsupported ECDHE-PSK curve")
+	}
+	ka.curve = curve
+
+	pointLen := int(data[3])
+	data = data[4:]
+	if len(data) < pointLen {
+		return errServerKeyExchange
+	}
+	x, y := elliptic.Unmarshal(curve, data[:pointLen])
+	if x == nil {
+		return errors.New("ztls: invalid ECDHE-PSK server public point")
+	}
+	ka.x, ka.y = x, y
+	return nil
+}
+
+// ServerKeyExchangeLog reports the identity hint the server sent, so that
+// scans can record which PSK identity a server expects without mutating
+// the shared Config.
+func (ka *ecdhePSKKeyAgreement) ServerKeyExchangeLog() *ServerKeyExchangeLog {
+	return &ServerKeyExchangeLog{PSKIdentityHint: ka.identityHint}
+}
+
+func (ka *ecdhePSKKeyAgreement) generateClientKeyExchange(config *Config, clientHello *clientHelloMsg, cert *x509.Certificate, version uint16) ([]byte, *clientKeyExchangeMsg, error) {
+	if ka.curve == nil {
+		return nil, nil, errors.New("ztls: missing ServerKeyExchange message")
+	}
+	identity, psk := pskKey(config, ka.identityHint)
+	if len(psk) == 0 {
+		return nil, nil, errors.New("ztls: no PSK configured for ECDHE-PSK cipher suite")
+	}
+
+	priv, mx, my, err := elliptic.GenerateKey(ka.curve, config.rand())
+	if err != nil {
+		return nil, nil, err
+	}
+	z, _ := ka.curve.ScalarMult(ka.x, ka.y, priv)
+	// z.Bytes() strips leading zero bytes, but RFC 5489/4492 require Z
+	// encoded to the curve's field length -- left-pad so the length
+	// prefix below and the encoding match what the server computed, even
+	// when the x-coordinate happens to have leading zero bytes.
+	fieldLen := (ka.curve.Params().BitSize + 7) / 8
+	ecdheSecret := make([]byte, fieldLen)
+	zBytes := z.Bytes()
+	copy(ecdheSecret[fieldLen-len(zBytes):], zBytes)
+
+	// RFC 5489 section 2: uint16(len(Z))||Z||uint16(len(PSK))||PSK.
+	preMasterSecret := pskPremaster(ecdheSecret, psk)
+
+	ckx := new(clientKeyExchangeMsg)
+	point := elliptic.Marshal(ka.curve, mx, my)
+	ckx.ciphertext = make([]byte, 0, 1+2+len(identity)+len(point))
+	ckx.ciphertext = appendUint16Opaque(ckx.ciphertext, []byte(identity))
+	ckx.ciphertext = append(ckx.ciphertext, byte(len(point)))
+	ckx.ciphertext = append(ckx.ciphertext, point...)
+	return preMasterSecret, ckx, nil
+}
+
+func (ka *ecdhePSKKeyAgreement) generateServerKeyExchange(config *Config, cert *Certificate, clientHello *clientHelloMsg, serverHello *serverHelloMsg) (*serverKeyExchangeMsg, error) {
+	return nil, errors.New("ztls: ECDHE-PSK server-side key exchange is not supported")
+}
+
+func (ka *ecdhePSKKeyAgreement) processClientKeyExchange(config *Config, cert *Certificate, ckx *clientKeyExchangeMsg, version uint16) ([]byte, error) {
+	return nil, errors.New("ztls: ECDHE-PSK server-side key exchange is not supported")
+}
+
+// readUint16Opaque reads a big-endian uint16-length-prefixed byte string
+// off the front of data, as used for the PSK identity hint/identity.
+func readUint16Opaque(data []byte) (value, rest []byte, err error) {
+	if len(data) < 2 {
+		return nil, nil, errServerKeyExchange
+	}
+	n := int(data[0])<<8 | int(data[1])
+	data = data[2:]
+	if len(data) < n {
+		return nil, nil, errServerKeyExchange
+	}
+	return data[:n], data[n:], nil
+}